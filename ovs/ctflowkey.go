@@ -0,0 +1,48 @@
+package ovs
+
+import "net"
+
+// CtFlowKey extracts the connection-tracking zone, 5-tuple and
+// tracked/established state from a flow's OVS_KEY_ATTR_CT_STATE,
+// OVS_KEY_ATTR_CT_ZONE and address/port key attributes. It is used
+// by ovs/ctjoin to match flow events against conntrack entries.
+func CtFlowKey(flow *OvsFlowInfo) (zone uint16, protocol uint8, srcIP net.IP, srcPort uint16, dstIP net.IP, dstPort uint16, trackedEstablished bool, ok bool) {
+	key := flow.FlowKeySpec.Key
+
+	ctState, ok := key[OVS_KEY_ATTR_CT_STATE].(OvsCtStateAttr)
+	if !ok {
+		return
+	}
+
+	trackedEstablished = ctState&OVS_CS_F_TRACKED != 0 && ctState&OVS_CS_F_ESTABLISHED != 0
+	if !trackedEstablished {
+		ok = false
+		return
+	}
+
+	if ctZone, present := key[OVS_KEY_ATTR_CT_ZONE].(OvsCtZoneAttr); present {
+		zone = uint16(ctZone)
+	}
+
+	ipv4, present := key[OVS_KEY_ATTR_IPV4].(OvsIPv4Key)
+	if !present {
+		ok = false
+		return
+	}
+
+	protocol = ipv4.Proto
+	srcIP = ipv4.Src
+	dstIP = ipv4.Dst
+
+	switch proto, present := key[OVS_KEY_ATTR_TCP].(OvsTpKey); {
+	case present:
+		srcPort, dstPort = proto.Src, proto.Dst
+	default:
+		if udp, present := key[OVS_KEY_ATTR_UDP].(OvsTpKey); present {
+			srcPort, dstPort = udp.Src, udp.Dst
+		}
+	}
+
+	ok = true
+	return
+}
@@ -0,0 +1,80 @@
+package ovs
+
+import (
+	"net"
+	"testing"
+)
+
+func trackedEstablishedKey() FlowKey {
+	return FlowKey{
+		OVS_KEY_ATTR_CT_STATE: OvsCtStateAttr(OVS_CS_F_TRACKED | OVS_CS_F_ESTABLISHED),
+		OVS_KEY_ATTR_CT_ZONE:  OvsCtZoneAttr(7),
+		OVS_KEY_ATTR_IPV4: OvsIPv4Key{
+			Src:   net.ParseIP("10.0.0.1").To4(),
+			Dst:   net.ParseIP("10.0.0.2").To4(),
+			Proto: 6,
+		},
+		OVS_KEY_ATTR_TCP: OvsTpKey{Src: 1234, Dst: 80},
+	}
+}
+
+func TestCtFlowKeyTrackedEstablished(t *testing.T) {
+	flow := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: trackedEstablishedKey()}}
+
+	zone, protocol, srcIP, srcPort, dstIP, dstPort, trackedEstablished, ok := CtFlowKey(flow)
+	if !ok {
+		t.Fatalf("CtFlowKey() ok = false, want true")
+	}
+	if !trackedEstablished {
+		t.Errorf("trackedEstablished = false, want true")
+	}
+	if zone != 7 {
+		t.Errorf("zone = %d, want 7", zone)
+	}
+	if protocol != 6 {
+		t.Errorf("protocol = %d, want 6", protocol)
+	}
+	if !srcIP.Equal(net.ParseIP("10.0.0.1")) || !dstIP.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("srcIP/dstIP = %v/%v, want 10.0.0.1/10.0.0.2", srcIP, dstIP)
+	}
+	if srcPort != 1234 || dstPort != 80 {
+		t.Errorf("srcPort/dstPort = %d/%d, want 1234/80", srcPort, dstPort)
+	}
+}
+
+func TestCtFlowKeyUDP(t *testing.T) {
+	key := trackedEstablishedKey()
+	delete(key, OVS_KEY_ATTR_TCP)
+	key[OVS_KEY_ATTR_UDP] = OvsTpKey{Src: 53, Dst: 53}
+
+	flow := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: key}}
+
+	_, _, _, srcPort, _, dstPort, _, ok := CtFlowKey(flow)
+	if !ok {
+		t.Fatalf("CtFlowKey() ok = false, want true")
+	}
+	if srcPort != 53 || dstPort != 53 {
+		t.Errorf("srcPort/dstPort = %d/%d, want 53/53", srcPort, dstPort)
+	}
+}
+
+func TestCtFlowKeyNotTrackedEstablished(t *testing.T) {
+	key := trackedEstablishedKey()
+	key[OVS_KEY_ATTR_CT_STATE] = OvsCtStateAttr(OVS_CS_F_TRACKED)
+
+	flow := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: key}}
+
+	_, _, _, _, _, _, trackedEstablished, ok := CtFlowKey(flow)
+	if ok || trackedEstablished {
+		t.Errorf("CtFlowKey() = (trackedEstablished=%v, ok=%v), want both false for an untracked/unestablished flow", trackedEstablished, ok)
+	}
+}
+
+func TestCtFlowKeyMissingCtState(t *testing.T) {
+	flow := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: FlowKey{}}}
+
+	_, _, _, _, _, _, _, ok := CtFlowKey(flow)
+	if ok {
+		t.Errorf("CtFlowKey() ok = true for a flow with no CT_STATE key, want false")
+	}
+}
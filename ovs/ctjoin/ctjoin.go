@@ -0,0 +1,238 @@
+// Package ctjoin correlates Open vSwitch flow events with conntrack
+// netlink events, so that a consumer of FollowOvsFlows can see which
+// connection-tracking entry backs a tracked/established flow, and
+// when that connection is torn down.
+package ctjoin
+
+import (
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/Tufin/conntrack/ovs"
+)
+
+type CtEventKind int
+
+const (
+	CtNew CtEventKind = iota
+	CtUpdate
+	CtDestroy
+)
+
+// ConntrackEntry is the subset of a conntrack netlink event that
+// ctjoin needs in order to match it against an OVS flow.
+type ConntrackEntry struct {
+	Zone     uint16
+	Protocol uint8
+	SrcIP    net.IP
+	SrcPort  uint16
+	DstIP    net.IP
+	DstPort  uint16
+	Mark     uint32
+	Labels   []byte
+}
+
+type EnrichedFlow struct {
+	Flow    *ovs.OvsFlowInfo
+	CtEntry *ConntrackEntry
+	CtEvent CtEventKind
+}
+
+type fiveTuple struct {
+	zone     uint16
+	protocol uint8
+	srcIP    string
+	srcPort  uint16
+	dstIP    string
+	dstPort  uint16
+}
+
+func tupleOf(e *ConntrackEntry) fiveTuple {
+	return fiveTuple{
+		zone:     e.Zone,
+		protocol: e.Protocol,
+		srcIP:    e.SrcIP.String(),
+		srcPort:  e.SrcPort,
+		dstIP:    e.DstIP.String(),
+		dstPort:  e.DstPort,
+	}
+}
+
+const defaultLRUSize = 4096
+
+// Join opens a conntrack netlink socket and merges its events with
+// the OVS flow events read from flows (typically the channel
+// returned by ovs.FollowOvsFlows). Flows whose ct_state indicates a
+// tracked, established connection are enriched with the matching
+// ConntrackEntry; when that entry is later destroyed a synthetic
+// close event is emitted for any flow it had been attached to.
+func Join(flows <-chan *ovs.OvsFlowInfo) (<-chan *EnrichedFlow, func(), error) {
+	ctSock, err := openCtSocket()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	j := &joiner{
+		ctSock:   ctSock,
+		entries:  newLRU(defaultLRUSize),
+		attached: make(map[fiveTuple]*ovs.OvsFlowInfo),
+	}
+
+	out := make(chan *EnrichedFlow)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		j.runCtLoop(out, done)
+	}()
+
+	go func() {
+		defer wg.Done()
+		j.runFlowLoop(flows, out, done)
+	}()
+
+	stop := func() {
+		close(done)
+		// runCtLoop is normally blocked in j.ctSock.Receive(), which
+		// only notices done between reads; closing the socket breaks
+		// it out of that blocking read. j.ctSock may have been
+		// swapped by reopenCtSock since Join returned, so close
+		// through j rather than the ctSock captured here.
+		j.closeCtSock()
+		wg.Wait()
+		close(out)
+	}
+
+	return out, stop, nil
+}
+
+type joiner struct {
+	ctSock *ctSocket
+
+	mu       sync.Mutex
+	entries  *lru
+	attached map[fiveTuple]*ovs.OvsFlowInfo
+}
+
+func (j *joiner) runCtLoop(out chan<- *EnrichedFlow, done <-chan struct{}) {
+	for {
+		j.mu.Lock()
+		sock := j.ctSock
+		j.mu.Unlock()
+
+		entries, events, err := sock.Receive()
+		if err != nil {
+			if err == syscall.ENOBUFS {
+				// Reopen a fresh socket bound to the same multicast
+				// groups rather than tearing the whole joiner down:
+				// the LRU and attached-flow state built up so far
+				// stay valid, they just came from the socket we're
+				// replacing.
+				if reopenErr := j.reopenCtSock(); reopenErr != nil {
+					return
+				}
+				continue
+			}
+
+			return
+		}
+
+		for i, entry := range entries {
+			tuple := tupleOf(entry)
+
+			switch events[i] {
+			case CtNew, CtUpdate:
+				j.mu.Lock()
+				j.entries.Put(tuple, entry)
+				flow := j.attached[tuple]
+				j.mu.Unlock()
+
+				if flow != nil {
+					j.deliver(out, done, &EnrichedFlow{Flow: flow, CtEntry: entry, CtEvent: events[i]})
+				}
+
+			case CtDestroy:
+				j.mu.Lock()
+				j.entries.Remove(tuple)
+				flow := j.attached[tuple]
+				delete(j.attached, tuple)
+				j.mu.Unlock()
+
+				if flow != nil {
+					j.deliver(out, done, &EnrichedFlow{Flow: flow, CtEntry: entry, CtEvent: CtDestroy})
+				}
+			}
+		}
+	}
+}
+
+func (j *joiner) runFlowLoop(flows <-chan *ovs.OvsFlowInfo, out chan<- *EnrichedFlow, done <-chan struct{}) {
+	for {
+		select {
+		case flow, ok := <-flows:
+			if !ok {
+				return
+			}
+
+			tuple, trackedEstablished, ok := flowTuple(flow)
+			if !ok || !trackedEstablished {
+				continue
+			}
+
+			j.mu.Lock()
+			entry := j.entries.Get(tuple)
+			if entry != nil {
+				j.attached[tuple] = flow
+			}
+			j.mu.Unlock()
+
+			if entry != nil {
+				j.deliver(out, done, &EnrichedFlow{Flow: flow, CtEntry: entry, CtEvent: CtUpdate})
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+func (j *joiner) deliver(out chan<- *EnrichedFlow, done <-chan struct{}, ef *EnrichedFlow) {
+	select {
+	case out <- ef:
+	case <-done:
+	}
+}
+
+// reopenCtSock swaps in a fresh conntrack socket bound to the same
+// multicast groups as the one it replaces, so a transient socket
+// error (e.g. ENOBUFS) doesn't tear down the LRU and attached-flow
+// state built up so far. The field is guarded by j.mu since stop
+// (via closeCtSock) can run concurrently with runCtLoop.
+func (j *joiner) reopenCtSock() error {
+	fresh, err := j.ctSock.Reopen()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	old := j.ctSock
+	j.ctSock = fresh
+	j.mu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+// closeCtSock closes the current conntrack socket, interrupting
+// runCtLoop's blocking Receive so stop can't hang waiting for the
+// next conntrack event.
+func (j *joiner) closeCtSock() error {
+	j.mu.Lock()
+	sock := j.ctSock
+	j.mu.Unlock()
+
+	return sock.Close()
+}
@@ -0,0 +1,61 @@
+package ctjoin
+
+import "container/list"
+
+// lru is a bounded, in-flight cache of conntrack entries keyed by
+// 5-tuple, used so that a flow event arriving slightly after its
+// conntrack NEW event can still find the entry to attach.
+type lru struct {
+	size int
+	ll   *list.List
+	m    map[fiveTuple]*list.Element
+}
+
+type lruEntry struct {
+	key   fiveTuple
+	value *ConntrackEntry
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size: size,
+		ll:   list.New(),
+		m:    make(map[fiveTuple]*list.Element),
+	}
+}
+
+func (c *lru) Get(key fiveTuple) *ConntrackEntry {
+	elem, ok := c.m[key]
+	if !ok {
+		return nil
+	}
+
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value
+}
+
+func (c *lru) Put(key fiveTuple, value *ConntrackEntry) {
+	if elem, ok := c.m[key]; ok {
+		c.ll.MoveToFront(elem)
+		elem.Value.(*lruEntry).value = value
+		return
+	}
+
+	elem := c.ll.PushFront(&lruEntry{key: key, value: value})
+	c.m[key] = elem
+
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.m, oldest.Value.(*lruEntry).key)
+		}
+	}
+}
+
+func (c *lru) Remove(key fiveTuple) {
+	if elem, ok := c.m[key]; ok {
+		c.ll.Remove(elem)
+		delete(c.m, key)
+	}
+}
@@ -0,0 +1,74 @@
+package ctjoin
+
+import "testing"
+
+func TestLRUGetPut(t *testing.T) {
+	c := newLRU(2)
+
+	tupleA := fiveTuple{srcIP: "1.1.1.1", dstIP: "2.2.2.2"}
+	entryA := &ConntrackEntry{SrcIP: nil}
+
+	if got := c.Get(tupleA); got != nil {
+		t.Fatalf("Get on empty cache = %v, want nil", got)
+	}
+
+	c.Put(tupleA, entryA)
+
+	if got := c.Get(tupleA); got != entryA {
+		t.Fatalf("Get(%v) = %v, want %v", tupleA, got, entryA)
+	}
+}
+
+func TestLRUEvictsOldestOverCapacity(t *testing.T) {
+	c := newLRU(2)
+
+	tupleA := fiveTuple{srcIP: "1.1.1.1"}
+	tupleB := fiveTuple{srcIP: "2.2.2.2"}
+	tupleC := fiveTuple{srcIP: "3.3.3.3"}
+
+	c.Put(tupleA, &ConntrackEntry{})
+	c.Put(tupleB, &ConntrackEntry{})
+	c.Put(tupleC, &ConntrackEntry{})
+
+	if got := c.Get(tupleA); got != nil {
+		t.Fatalf("Get(tupleA) after eviction = %v, want nil", got)
+	}
+	if got := c.Get(tupleB); got == nil {
+		t.Fatalf("Get(tupleB) = nil, want non-nil")
+	}
+	if got := c.Get(tupleC); got == nil {
+		t.Fatalf("Get(tupleC) = nil, want non-nil")
+	}
+}
+
+func TestLRUGetRefreshesRecency(t *testing.T) {
+	c := newLRU(2)
+
+	tupleA := fiveTuple{srcIP: "1.1.1.1"}
+	tupleB := fiveTuple{srcIP: "2.2.2.2"}
+	tupleC := fiveTuple{srcIP: "3.3.3.3"}
+
+	c.Put(tupleA, &ConntrackEntry{})
+	c.Put(tupleB, &ConntrackEntry{})
+	c.Get(tupleA) // touch A so B becomes the oldest
+	c.Put(tupleC, &ConntrackEntry{})
+
+	if got := c.Get(tupleB); got != nil {
+		t.Fatalf("Get(tupleB) after eviction = %v, want nil", got)
+	}
+	if got := c.Get(tupleA); got == nil {
+		t.Fatalf("Get(tupleA) = nil, want non-nil")
+	}
+}
+
+func TestLRURemove(t *testing.T) {
+	c := newLRU(2)
+
+	tuple := fiveTuple{srcIP: "1.1.1.1"}
+	c.Put(tuple, &ConntrackEntry{})
+	c.Remove(tuple)
+
+	if got := c.Get(tuple); got != nil {
+		t.Fatalf("Get(tuple) after Remove = %v, want nil", got)
+	}
+}
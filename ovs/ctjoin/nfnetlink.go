@@ -0,0 +1,256 @@
+package ctjoin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/Tufin/conntrack/ovs"
+)
+
+// nativeEndian is the byte order of struct nlattr's len/type fields,
+// which netlink always encodes in host order.
+var nativeEndian = func() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// netfilter netlink, see linux/netfilter/nfnetlink.h and
+// linux/netfilter/nfnetlink_conntrack.h
+const (
+	nfnlSubsysCtNetlink = 1
+
+	ipctnlMsgCtNew    = 0
+	ipctnlMsgCtDelete = 2
+
+	nfnlgrpConntrackNew     = 1
+	nfnlgrpConntrackUpdate  = 2
+	nfnlgrpConntrackDestroy = 3
+
+	ctaTupleOrig = 1
+	ctaMark      = 8
+	ctaZone      = 18
+	ctaLabels    = 22
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+)
+
+func ctMsgType(msg uint8) uint16 {
+	return uint16(nfnlSubsysCtNetlink)<<8 | uint16(msg)
+}
+
+type ctSocket struct {
+	fd     int
+	groups uint32
+}
+
+func openCtSocket() (*ctSocket, error) {
+	groups := uint32(1<<(nfnlgrpConntrackNew-1) | 1<<(nfnlgrpConntrackUpdate-1) | 1<<(nfnlgrpConntrackDestroy-1))
+	return bindCtSocket(groups)
+}
+
+// Reopen opens a fresh netlink socket bound to the same conntrack
+// multicast groups as this one, so the group numbers don't need to
+// be re-derived after a socket-level error.
+func (s *ctSocket) Reopen() (*ctSocket, error) {
+	return bindCtSocket(s.groups)
+}
+
+func bindCtSocket(groups uint32) (*ctSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &ctSocket{fd: fd, groups: groups}, nil
+}
+
+func (s *ctSocket) Close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *ctSocket) Receive() ([]*ConntrackEntry, []CtEventKind, error) {
+	buf := make([]byte, syscall.Getpagesize())
+
+	n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []*ConntrackEntry
+	var events []CtEventKind
+
+	for _, msg := range msgs {
+		var kind CtEventKind
+		switch msg.Header.Type {
+		case ctMsgType(ipctnlMsgCtNew):
+			kind = CtNew
+			if msg.Header.Flags&syscall.NLM_F_CREATE == 0 {
+				kind = CtUpdate
+			}
+		case ctMsgType(ipctnlMsgCtDelete):
+			kind = CtDestroy
+		default:
+			continue
+		}
+
+		entry, err := parseCtEntry(msg.Data)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+		events = append(events, kind)
+	}
+
+	return entries, events, nil
+}
+
+// parseCtEntry walks the nfgenmsg header and CTA_* nested attributes
+// of a single conntrack netlink message and extracts the 5-tuple,
+// mark and labels needed to join against an OVS flow.
+func parseCtEntry(data []byte) (*ConntrackEntry, error) {
+	// struct nfgenmsg { u8 family; u8 version; u16 res_id; }
+	if len(data) < 4 {
+		return nil, fmt.Errorf("ctjoin: short conntrack message")
+	}
+
+	entry := &ConntrackEntry{}
+	attrs, err := parseAttrs(data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	tuple, ok := attrs[ctaTupleOrig]
+	if !ok {
+		return nil, fmt.Errorf("ctjoin: conntrack message missing CTA_TUPLE_ORIG")
+	}
+
+	if err := parseTuple(tuple, entry); err != nil {
+		return nil, err
+	}
+
+	if mark, ok := attrs[ctaMark]; ok && len(mark) == 4 {
+		entry.Mark = binary.BigEndian.Uint32(mark)
+	}
+
+	if zone, ok := attrs[ctaZone]; ok && len(zone) == 2 {
+		entry.Zone = binary.BigEndian.Uint16(zone)
+	}
+
+	if labels, ok := attrs[ctaLabels]; ok {
+		entry.Labels = labels
+	}
+
+	return entry, nil
+}
+
+func parseTuple(data []byte, entry *ConntrackEntry) error {
+	attrs, err := parseAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	if ipAttrs, ok := attrs[ctaTupleIP]; ok {
+		ip, err := parseAttrs(ipAttrs)
+		if err != nil {
+			return err
+		}
+
+		if src, ok := ip[ctaIPv4Src]; ok {
+			entry.SrcIP = net.IP(src)
+		}
+		if dst, ok := ip[ctaIPv4Dst]; ok {
+			entry.DstIP = net.IP(dst)
+		}
+	}
+
+	if protoAttrs, ok := attrs[ctaTupleProto]; ok {
+		proto, err := parseAttrs(protoAttrs)
+		if err != nil {
+			return err
+		}
+
+		if num, ok := proto[ctaProtoNum]; ok && len(num) == 1 {
+			entry.Protocol = num[0]
+		}
+		if src, ok := proto[ctaProtoSrcPort]; ok && len(src) == 2 {
+			entry.SrcPort = binary.BigEndian.Uint16(src)
+		}
+		if dst, ok := proto[ctaProtoDstPort]; ok && len(dst) == 2 {
+			entry.DstPort = binary.BigEndian.Uint16(dst)
+		}
+	}
+
+	return nil
+}
+
+const ctaMax = 1 << 15
+
+// parseAttrs walks a flat run of netlink attributes (struct nlattr)
+// and returns the payload of each by type, ignoring the nested flag.
+func parseAttrs(data []byte) (map[int][]byte, error) {
+	attrs := make(map[int][]byte)
+
+	for len(data) >= 4 {
+		alen := nativeEndian.Uint16(data[0:2])
+		atype := nativeEndian.Uint16(data[2:4]) &^ ctaMax
+
+		if int(alen) > len(data) || alen < 4 {
+			return nil, fmt.Errorf("ctjoin: malformed netlink attribute")
+		}
+
+		attrs[int(atype)] = data[4:alen]
+
+		pad := (int(alen) + 3) &^ 3
+		if pad > len(data) {
+			break
+		}
+		data = data[pad:]
+	}
+
+	return attrs, nil
+}
+
+// flowTuple extracts the 5-tuple from an OVS flow's key attributes
+// and reports whether ct_state includes both +trk and +est, i.e.
+// this flow belongs to an already-tracked, established connection.
+func flowTuple(flow *ovs.OvsFlowInfo) (fiveTuple, bool, bool) {
+	zone, protocol, srcIP, srcPort, dstIP, dstPort, trackedEstablished, ok := ovs.CtFlowKey(flow)
+	if !ok {
+		return fiveTuple{}, false, false
+	}
+
+	return fiveTuple{
+		zone:     zone,
+		protocol: protocol,
+		srcIP:    srcIP.String(),
+		srcPort:  srcPort,
+		dstIP:    dstIP.String(),
+		dstPort:  dstPort,
+	}, trackedEstablished, true
+}
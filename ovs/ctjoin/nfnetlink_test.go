@@ -0,0 +1,84 @@
+package ctjoin
+
+import (
+	"bytes"
+	"testing"
+)
+
+// putAttr builds one TLV-encoded netlink attribute, padded to a
+// 4-byte boundary, mirroring what parseAttrs expects to walk.
+func putAttr(atype uint16, value []byte) []byte {
+	alen := 4 + len(value)
+	buf := make([]byte, (alen+3)&^3)
+
+	nativeEndian.PutUint16(buf[0:2], uint16(alen))
+	nativeEndian.PutUint16(buf[2:4], atype)
+	copy(buf[4:], value)
+
+	return buf
+}
+
+func TestParseAttrs(t *testing.T) {
+	var data []byte
+	data = append(data, putAttr(ctaMark, []byte{0, 0, 0, 42})...)
+	data = append(data, putAttr(ctaZone, []byte{0, 7})...)
+
+	attrs, err := parseAttrs(data)
+	if err != nil {
+		t.Fatalf("parseAttrs: %v", err)
+	}
+
+	if got, want := attrs[ctaMark], []byte{0, 0, 0, 42}; !bytes.Equal(got, want) {
+		t.Errorf("attrs[ctaMark] = %v, want %v", got, want)
+	}
+	if got, want := attrs[ctaZone], []byte{0, 7}; !bytes.Equal(got, want) {
+		t.Errorf("attrs[ctaZone] = %v, want %v", got, want)
+	}
+}
+
+func TestParseAttrsStripsNestedFlag(t *testing.T) {
+	data := putAttr(ctaTupleOrig|ctaMax, []byte{1, 2, 3, 4})
+
+	attrs, err := parseAttrs(data)
+	if err != nil {
+		t.Fatalf("parseAttrs: %v", err)
+	}
+
+	if _, ok := attrs[ctaTupleOrig]; !ok {
+		t.Fatalf("attrs[ctaTupleOrig] missing, nested flag wasn't stripped")
+	}
+}
+
+func TestParseAttrsMalformed(t *testing.T) {
+	if _, err := parseAttrs([]byte{0xff, 0xff, 0, 0}); err == nil {
+		t.Fatal("parseAttrs with an out-of-range length = nil error, want one")
+	}
+}
+
+// TestParseCtEntryZoneAndLabels guards against ctaZone/ctaLabels
+// regressing to the wrong CTA_* ids (CTA_ZONE was once left
+// unhandled and CTA_LABELS collided with CTA_SEQ_ADJ_ORIG).
+func TestParseCtEntryZoneAndLabels(t *testing.T) {
+	ipTuple := append(putAttr(ctaIPv4Src, []byte{10, 0, 0, 1}), putAttr(ctaIPv4Dst, []byte{10, 0, 0, 2})...)
+	protoTuple := append(putAttr(ctaProtoNum, []byte{6}), putAttr(ctaProtoSrcPort, []byte{0, 80})...)
+	protoTuple = append(protoTuple, putAttr(ctaProtoDstPort, []byte{0, 443})...)
+
+	tuple := append(putAttr(ctaTupleIP, ipTuple), putAttr(ctaTupleProto, protoTuple)...)
+
+	var msg []byte
+	msg = append(msg, putAttr(ctaTupleOrig, tuple)...)
+	msg = append(msg, putAttr(ctaZone, []byte{0, 3})...)
+	msg = append(msg, putAttr(ctaLabels, []byte{1, 2, 3, 4})...)
+
+	entry, err := parseCtEntry(append([]byte{0, 0, 0, 0}, msg...))
+	if err != nil {
+		t.Fatalf("parseCtEntry: %v", err)
+	}
+
+	if entry.Zone != 3 {
+		t.Errorf("entry.Zone = %d, want 3", entry.Zone)
+	}
+	if !bytes.Equal(entry.Labels, []byte{1, 2, 3, 4}) {
+		t.Errorf("entry.Labels = %v, want [1 2 3 4]", entry.Labels)
+	}
+}
@@ -26,6 +26,12 @@ type Dpif struct {
 	sock *NetlinkSocket
 
 	families [FAMILY_COUNT]GenlFamily
+
+	// Cumulative counters for FollowFlowsWithOptions subscriptions,
+	// safe for concurrent/Prometheus-style reads via sync/atomic.
+	EventsReceived  uint64
+	EventsDropped   uint64
+	EventsCoalesced uint64
 }
 
 func (dpif *Dpif) Families() [FAMILY_COUNT]GenlFamily {
@@ -196,6 +202,8 @@ func (dpif *Dpif) checkNlMsgHeaders(msg *NlMsgParser, family int, cmd int) (*Gen
 		genlhdr, err = msg.CheckGenlMsghdr(cmd, OVS_VPORT_CMD_NEW)
 	case FLOW:
 		genlhdr, err = msg.CheckGenlMsghdr(cmd, OVS_FLOW_CMD_NEW)
+	case PACKET:
+		genlhdr, err = msg.CheckGenlMsghdr(cmd, -1)
 	default:
 		genlhdr, err = msg.CheckGenlMsghdr(cmd, -1)
 	}
@@ -0,0 +1,238 @@
+package ovs
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// FollowOptions tunes a FollowFlowsWithOptions subscription to
+// tolerate bursts that would otherwise overflow the netlink socket
+// and result in silent ENOBUFS drops.
+type FollowOptions struct {
+	// BufferBytes sets SO_RCVBUF (or SO_RCVBUFFORCE, if permitted)
+	// on the follow socket before joining the ovs_flow multicast
+	// group.
+	BufferBytes int
+
+	// ChannelDepth sizes the buffered channel events are delivered
+	// on, decoupling the netlink reader from a slow consumer.
+	ChannelDepth int
+
+	// OnDrop, if set, is called whenever recvmsg reports ENOBUFS,
+	// with the Dpif's cumulative EventsDropped count.
+	OnDrop func(dropped uint64)
+
+	// Coalesce collapses consecutive updates for the same flow key
+	// into the latest one before delivery, so a hot flow can't
+	// starve the channel of other flows' events. Pending updates
+	// are held and flushed on coalesceFlushInterval rather than on
+	// every netlink read, since live flow churn is normally one
+	// message per read.
+	Coalesce bool
+}
+
+// coalesceFlushInterval is how often a Coalesce subscription drains
+// its pending, deduplicated updates to the output channel.
+const coalesceFlushInterval = 100 * time.Millisecond
+
+// FollowFlowsWithOptions is like FollowFlows but lets a caller size
+// the socket receive buffer and channel depth, and observe or
+// coalesce drops under load instead of losing events silently.
+func (dph *DatapathHandle) FollowFlowsWithOptions(opts FollowOptions) (<-chan *OvsFlowInfo, func(), error) {
+	dpif := dph.dpif
+
+	if opts.BufferBytes > 0 {
+		if err := setRcvBuf(dpif.sock.fd, opts.BufferBytes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	group, err := dpif.getMCGroup(FLOW, "ovs_flow")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := syscall.SetsockoptInt(dpif.sock.fd, SOL_NETLINK, syscall.NETLINK_ADD_MEMBERSHIP, int(group)); err != nil {
+		return nil, nil, err
+	}
+
+	depth := opts.ChannelDepth
+	if depth <= 0 {
+		depth = 1
+	}
+
+	out := make(chan *OvsFlowInfo, depth)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		if opts.Coalesce {
+			dph.runCoalescingFollowLoop(opts, out, done)
+		} else {
+			dph.runDirectFollowLoop(opts, out, done)
+		}
+	}()
+
+	stop := func() {
+		close(done)
+		// receiveFlows is normally blocked in
+		// dpif.sock.ReceiveMulti(), which only notices done between
+		// reads; closing the socket breaks it out of that blocking
+		// read so stop() can't hang when traffic goes quiet.
+		dpif.sock.Close()
+		wg.Wait()
+	}
+
+	return out, stop, nil
+}
+
+// runDirectFollowLoop delivers each decoded flow to out as soon as
+// it's read, with no coalescing.
+func (dph *DatapathHandle) runDirectFollowLoop(opts FollowOptions, out chan<- *OvsFlowInfo, done <-chan struct{}) {
+	defer close(out)
+
+	dph.receiveFlows(opts, done, func(flow *OvsFlowInfo) bool {
+		select {
+		case out <- flow:
+			return true
+		case <-done:
+			return false
+		}
+	})
+}
+
+// runCoalescingFollowLoop accumulates decoded flows into a
+// per-key-hash pending map, guarded by mu since it's drained by a
+// separate ticker goroutine, and flushes the latest update per key
+// every coalesceFlushInterval instead of after every netlink read.
+func (dph *DatapathHandle) runCoalescingFollowLoop(opts FollowOptions, out chan<- *OvsFlowInfo, done <-chan struct{}) {
+	defer close(out)
+
+	var mu sync.Mutex
+	pending := make(map[uint64]*OvsFlowInfo)
+
+	flush := func() bool {
+		mu.Lock()
+		toSend := pending
+		pending = make(map[uint64]*OvsFlowInfo)
+		mu.Unlock()
+
+		for _, flow := range toSend {
+			select {
+			case out <- flow:
+			case <-done:
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var flusher sync.WaitGroup
+	stopFlusher := make(chan struct{})
+	flusher.Add(1)
+	go func() {
+		defer flusher.Done()
+
+		ticker := time.NewTicker(coalesceFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if !flush() {
+					return
+				}
+			case <-stopFlusher:
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stopFlusher)
+		flusher.Wait()
+		flush()
+	}()
+
+	dph.receiveFlows(opts, done, func(flow *OvsFlowInfo) bool {
+		key := hashFlowKey(flow)
+		dpif := dph.dpif
+
+		mu.Lock()
+		if _, dup := pending[key]; dup {
+			atomic.AddUint64(&dpif.EventsCoalesced, 1)
+		}
+		pending[key] = flow
+		mu.Unlock()
+
+		return true
+	})
+}
+
+// receiveFlows reads and decodes ovs_flow netlink events until done
+// is closed or a non-ENOBUFS socket error occurs, invoking deliver
+// for each one; it stops as soon as deliver returns false.
+func (dph *DatapathHandle) receiveFlows(opts FollowOptions, done <-chan struct{}, deliver func(*OvsFlowInfo) bool) {
+	dpif := dph.dpif
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		msgs, err := dpif.sock.ReceiveMulti()
+		if err != nil {
+			if err == NetlinkError(syscall.ENOBUFS) {
+				dropped := atomic.AddUint64(&dpif.EventsDropped, 1)
+				if opts.OnDrop != nil {
+					opts.OnDrop(dropped)
+				}
+				continue
+			}
+
+			return
+		}
+
+		for _, msg := range msgs {
+			_, ovshdr, err := dpif.checkNlMsgHeaders(msg, FLOW, -1)
+			if err != nil {
+				continue
+			}
+
+			flow, err := parseFlowInfo(msg, ovshdr)
+			if err != nil {
+				continue
+			}
+
+			atomic.AddUint64(&dpif.EventsReceived, 1)
+
+			if !deliver(flow) {
+				return
+			}
+		}
+	}
+}
+
+func setRcvBuf(fd, bytes int) error {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, bytes); err == nil {
+		return nil
+	}
+
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, bytes)
+}
+
+func hashFlowKey(flow *OvsFlowInfo) uint64 {
+	h := fnv.New64a()
+	h.Write(flow.FlowKeySpec.Key.Bytes())
+	return h.Sum64()
+}
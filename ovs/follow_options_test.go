@@ -0,0 +1,37 @@
+package ovs
+
+import (
+	"net"
+	"testing"
+)
+
+func TestHashFlowKeyStableForEqualKeys(t *testing.T) {
+	key := func() FlowKey {
+		return FlowKey{
+			OVS_KEY_ATTR_IPV4: OvsIPv4Key{Src: net.ParseIP("10.0.0.1").To4(), Dst: net.ParseIP("10.0.0.2").To4(), Proto: 6},
+			OVS_KEY_ATTR_TCP:  OvsTpKey{Src: 1234, Dst: 80},
+		}
+	}
+
+	a := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: key()}}
+	b := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: key()}}
+
+	if hashFlowKey(a) != hashFlowKey(b) {
+		t.Errorf("hashFlowKey differs for two flows with identical keys")
+	}
+}
+
+func TestHashFlowKeyDiffersForDifferentKeys(t *testing.T) {
+	a := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: FlowKey{
+		OVS_KEY_ATTR_IPV4: OvsIPv4Key{Src: net.ParseIP("10.0.0.1").To4(), Dst: net.ParseIP("10.0.0.2").To4(), Proto: 6},
+		OVS_KEY_ATTR_TCP:  OvsTpKey{Src: 1234, Dst: 80},
+	}}}
+	b := &OvsFlowInfo{FlowKeySpec: FlowKeySpec{Key: FlowKey{
+		OVS_KEY_ATTR_IPV4: OvsIPv4Key{Src: net.ParseIP("10.0.0.1").To4(), Dst: net.ParseIP("10.0.0.3").To4(), Proto: 6},
+		OVS_KEY_ATTR_TCP:  OvsTpKey{Src: 1234, Dst: 80},
+	}}}
+
+	if hashFlowKey(a) == hashFlowKey(b) {
+		t.Errorf("hashFlowKey collided for two flows with different keys")
+	}
+}
@@ -0,0 +1,283 @@
+// Package ipsetsync mirrors named ipsets into synthetic Open
+// vSwitch flow classifier tables, so that ipset membership (as
+// managed by iptables/nftables tooling) can drive datapath rules
+// without a separate agent re-implementing set matching in OVS.
+package ipsetsync
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Tufin/conntrack/ovs"
+)
+
+// IpsetMapping ties one ipset to the datapath table it should
+// populate, and the action to install for each of its members.
+type IpsetMapping struct {
+	SetName  string
+	Datapath ovs.DatapathID
+	Table    uint8
+	Action   ovs.FlowActions
+}
+
+// IpsetSync keeps the datapath tables named by a set of IpsetMappings
+// in sync with kernel ipset membership, via NFNL_SUBSYS_IPSET change
+// notifications.
+type IpsetSync struct {
+	dpif     *ovs.Dpif
+	mappings map[string]IpsetMapping
+	sock     *ipsetSocket
+
+	mu      sync.Mutex
+	members map[string]map[string]bool
+}
+
+// NewIpsetSync opens a NETLINK_NETFILTER socket subscribed to ipset
+// change notifications and returns a syncer for the given mappings.
+// Call Reconcile to seed the tables before consuming Run.
+func NewIpsetSync(dpif *ovs.Dpif, mappings []IpsetMapping) (*IpsetSync, error) {
+	sock, err := openIpsetSocket()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]IpsetMapping, len(mappings))
+	for _, m := range mappings {
+		byName[m.SetName] = m
+	}
+
+	return &IpsetSync{
+		dpif:     dpif,
+		mappings: byName,
+		sock:     sock,
+		members:  make(map[string]map[string]bool, len(mappings)),
+	}, nil
+}
+
+// Reconcile does an initial IPSET_CMD_LIST dump of every mapped set
+// and installs a flow for each current member, so the tables are
+// correct before the change-notification stream takes over.
+func (s *IpsetSync) Reconcile() error {
+	for name, mapping := range s.mappings {
+		members, err := s.sock.list(name)
+		if err != nil {
+			return fmt.Errorf("ipsetsync: listing %q: %w", name, err)
+		}
+
+		set := make(map[string]bool, len(members))
+		for _, member := range members {
+			if err := s.installMember(mapping, member); err != nil {
+				return err
+			}
+			set[member] = true
+		}
+
+		s.mu.Lock()
+		s.members[name] = set
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Run consumes IPSET_CMD_ADD/DEL/FLUSH/SWAP notifications until done
+// is closed, keeping the mapped datapath tables in sync.
+func (s *IpsetSync) Run(done <-chan struct{}) error {
+	for {
+		changes, err := s.sock.receive()
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		for _, change := range changes {
+			mapping, ok := s.mappings[change.setName]
+			if !ok {
+				continue
+			}
+
+			switch change.cmd {
+			case ipsetCmdAdd:
+				s.addMember(mapping, change.member)
+			case ipsetCmdDel:
+				s.delMember(mapping, change.member)
+			case ipsetCmdFlush:
+				s.flushSet(mapping)
+			case ipsetCmdSwap:
+				s.swapSets(mapping, change.other)
+			}
+		}
+
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+	}
+}
+
+func (s *IpsetSync) Close() error {
+	return s.sock.Close()
+}
+
+// IANA IP protocol numbers, used to tell a hash:ip,port member's TCP
+// port apart from its UDP one.
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
+)
+
+// memberKey turns one ipset member -- a bare IP for hash:ip, a CIDR
+// for hash:net, or "ip,port" / "ip,port,proto" for hash:ip,port --
+// into the OVS_KEY_ATTR_* flow key that classifies traffic matching
+// it. proto defaults to TCP when the member doesn't specify one.
+func memberKey(member string) (ovs.FlowKey, error) {
+	parts := strings.Split(member, ",")
+
+	ip, ipNet, err := net.ParseCIDR(parts[0])
+	if err != nil {
+		ip = net.ParseIP(parts[0])
+		if ip == nil {
+			return nil, fmt.Errorf("ipsetsync: invalid ipset member %q", member)
+		}
+		ipNet = nil
+	}
+
+	key := ovs.FlowKey{
+		ovs.OVS_KEY_ATTR_IPV4: ovs.OvsIPv4Key{Dst: ip.To4(), DstMask: netMask(ipNet)},
+	}
+
+	if len(parts) < 2 {
+		return key, nil
+	}
+
+	port, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("ipsetsync: invalid ipset member %q: %w", member, err)
+	}
+
+	proto := uint8(ipProtoTCP)
+	if len(parts) >= 3 {
+		p, err := strconv.ParseUint(parts[2], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("ipsetsync: invalid ipset member %q: %w", member, err)
+		}
+		proto = uint8(p)
+	}
+
+	if proto == ipProtoUDP {
+		key[ovs.OVS_KEY_ATTR_UDP] = ovs.OvsTpKey{Dst: uint16(port)}
+	} else {
+		key[ovs.OVS_KEY_ATTR_TCP] = ovs.OvsTpKey{Dst: uint16(port)}
+	}
+
+	return key, nil
+}
+
+func netMask(ipNet *net.IPNet) net.IPMask {
+	if ipNet == nil {
+		return net.CIDRMask(32, 32)
+	}
+
+	return ipNet.Mask
+}
+
+func (s *IpsetSync) installMember(mapping IpsetMapping, member string) error {
+	key, err := memberKey(member)
+	if err != nil {
+		return err
+	}
+
+	return s.dpif.PutFlow(mapping.Datapath, ovs.FlowSpec{
+		Table:  mapping.Table,
+		Key:    key,
+		Action: mapping.Action,
+	})
+}
+
+func (s *IpsetSync) removeMember(mapping IpsetMapping, member string) error {
+	key, err := memberKey(member)
+	if err != nil {
+		return err
+	}
+
+	return s.dpif.DelFlow(mapping.Datapath, ovs.FlowSpec{Table: mapping.Table, Key: key})
+}
+
+func (s *IpsetSync) addMember(mapping IpsetMapping, member string) {
+	s.mu.Lock()
+	set, ok := s.members[mapping.SetName]
+	if !ok {
+		set = make(map[string]bool)
+		s.members[mapping.SetName] = set
+	}
+	set[member] = true
+	s.mu.Unlock()
+
+	s.installMember(mapping, member)
+}
+
+func (s *IpsetSync) delMember(mapping IpsetMapping, member string) {
+	s.mu.Lock()
+	delete(s.members[mapping.SetName], member)
+	s.mu.Unlock()
+
+	s.removeMember(mapping, member)
+}
+
+func (s *IpsetSync) flushSet(mapping IpsetMapping) {
+	s.mu.Lock()
+	members := s.members[mapping.SetName]
+	s.members[mapping.SetName] = make(map[string]bool)
+	s.mu.Unlock()
+
+	for member := range members {
+		s.removeMember(mapping, member)
+	}
+}
+
+// swapSets handles IPSET_CMD_SWAP, which exchanges which members
+// belong to which set name. Each mapping's datapath table is keyed
+// by mapping, not by set name, so swapping only the in-memory
+// bookkeeping would leave both tables showing their pre-swap
+// members; diff each mapping's old members against its new ones and
+// install/remove flows for the difference.
+func (s *IpsetSync) swapSets(mapping IpsetMapping, otherName string) {
+	other, ok := s.mappings[otherName]
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	before := s.members[mapping.SetName]
+	otherBefore := s.members[other.SetName]
+	s.members[mapping.SetName], s.members[other.SetName] = otherBefore, before
+	s.mu.Unlock()
+
+	s.reprogram(mapping, before, otherBefore)
+	s.reprogram(other, otherBefore, before)
+}
+
+// reprogram brings mapping's datapath table from oldMembers to
+// newMembers by removing flows no longer present and installing
+// flows newly present.
+func (s *IpsetSync) reprogram(mapping IpsetMapping, oldMembers, newMembers map[string]bool) {
+	for member := range oldMembers {
+		if !newMembers[member] {
+			s.removeMember(mapping, member)
+		}
+	}
+
+	for member := range newMembers {
+		if !oldMembers[member] {
+			s.installMember(mapping, member)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ipsetsync
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Tufin/conntrack/ovs"
+)
+
+func TestMemberKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		member  string
+		wantKey ovs.FlowKey
+		wantErr bool
+	}{
+		{
+			name:   "bare ip",
+			member: "10.0.0.1",
+			wantKey: ovs.FlowKey{
+				ovs.OVS_KEY_ATTR_IPV4: ovs.OvsIPv4Key{Dst: net.ParseIP("10.0.0.1").To4(), DstMask: net.CIDRMask(32, 32)},
+			},
+		},
+		{
+			name:   "cidr",
+			member: "10.0.0.0/24",
+			wantKey: ovs.FlowKey{
+				ovs.OVS_KEY_ATTR_IPV4: ovs.OvsIPv4Key{Dst: net.ParseIP("10.0.0.0").To4(), DstMask: net.CIDRMask(24, 32)},
+			},
+		},
+		{
+			name:   "ip and port defaults to tcp",
+			member: "10.0.0.1,8080",
+			wantKey: ovs.FlowKey{
+				ovs.OVS_KEY_ATTR_IPV4: ovs.OvsIPv4Key{Dst: net.ParseIP("10.0.0.1").To4(), DstMask: net.CIDRMask(32, 32)},
+				ovs.OVS_KEY_ATTR_TCP:  ovs.OvsTpKey{Dst: 8080},
+			},
+		},
+		{
+			name:   "ip, port and udp protocol",
+			member: "10.0.0.1,53,17",
+			wantKey: ovs.FlowKey{
+				ovs.OVS_KEY_ATTR_IPV4: ovs.OvsIPv4Key{Dst: net.ParseIP("10.0.0.1").To4(), DstMask: net.CIDRMask(32, 32)},
+				ovs.OVS_KEY_ATTR_UDP:  ovs.OvsTpKey{Dst: 53},
+			},
+		},
+		{
+			name:    "invalid ip",
+			member:  "not-an-ip",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			member:  "10.0.0.1,not-a-port",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := memberKey(tt.member)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("memberKey(%q) error = %v, wantErr %v", tt.member, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			gotIPv4 := key[ovs.OVS_KEY_ATTR_IPV4].(ovs.OvsIPv4Key)
+			wantIPv4 := tt.wantKey[ovs.OVS_KEY_ATTR_IPV4].(ovs.OvsIPv4Key)
+			if !gotIPv4.Dst.Equal(wantIPv4.Dst) || gotIPv4.DstMask.String() != wantIPv4.DstMask.String() {
+				t.Errorf("memberKey(%q) ipv4 = %+v, want %+v", tt.member, gotIPv4, wantIPv4)
+			}
+
+			if wantTCP, ok := tt.wantKey[ovs.OVS_KEY_ATTR_TCP]; ok {
+				if got := key[ovs.OVS_KEY_ATTR_TCP]; got != wantTCP {
+					t.Errorf("memberKey(%q) tcp = %+v, want %+v", tt.member, got, wantTCP)
+				}
+			}
+			if wantUDP, ok := tt.wantKey[ovs.OVS_KEY_ATTR_UDP]; ok {
+				if got := key[ovs.OVS_KEY_ATTR_UDP]; got != wantUDP {
+					t.Errorf("memberKey(%q) udp = %+v, want %+v", tt.member, got, wantUDP)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package ipsetsync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// netfilter ipset netlink, see linux/netfilter/ipset/ip_set.h
+const (
+	nfnlSubsysIpset = 6
+
+	ipsetCmdAdd   = 9
+	ipsetCmdDel   = 10
+	ipsetCmdFlush = 4
+	ipsetCmdSwap  = 6
+	ipsetCmdList  = 7
+
+	ipsetAttrSetname  = 2
+	ipsetAttrTypename = 3
+	ipsetAttrData     = 7
+	ipsetAttrADT      = 8
+
+	ipsetAttrIP         = 1
+	ipsetAttrIPTo       = 2
+	ipsetAttrCIDR       = 3
+	ipsetAttrPort       = 4
+	ipsetAttrProto      = 7
+	ipsetAttrIPAddrIPv4 = 1
+)
+
+var nativeEndian = func() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+func ipsetMsgType(msg uint8) uint16 {
+	return uint16(nfnlSubsysIpset)<<8 | uint16(msg)
+}
+
+type ipsetChange struct {
+	cmd     uint8
+	setName string
+	member  string
+	other   string // IPSET_CMD_SWAP's second set name
+}
+
+type ipsetSocket struct {
+	fd int
+}
+
+func openIpsetSocket() (*ipsetSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+
+	// NFNLGRP_IPSET, see linux/netfilter/nfnetlink.h
+	const nfnlgrpIpset = 1 << (13 - 1)
+
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: nfnlgrpIpset}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &ipsetSocket{fd: fd}, nil
+}
+
+func (s *ipsetSocket) Close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *ipsetSocket) receive() ([]ipsetChange, error) {
+	buf := make([]byte, syscall.Getpagesize())
+
+	n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ipsetChange
+	for _, msg := range msgs {
+		cmd, ok := ipsetCmdOf(msg.Header.Type)
+		if !ok {
+			continue
+		}
+
+		change, err := parseIpsetChange(cmd, msg.Data)
+		if err != nil {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func ipsetCmdOf(nlType uint16) (uint8, bool) {
+	for _, cmd := range []uint8{ipsetCmdAdd, ipsetCmdDel, ipsetCmdFlush, ipsetCmdSwap} {
+		if nlType == ipsetMsgType(cmd) {
+			return cmd, true
+		}
+	}
+
+	return 0, false
+}
+
+// list issues an IPSET_CMD_LIST dump for name and returns its
+// current members as dotted-quad strings (or CIDRs for hash:net
+// sets, or "ip,port" / "ip,port,proto" for hash:ip,port sets).
+func (s *ipsetSocket) list(name string) ([]string, error) {
+	// dumpSet sends the request with NLM_F_DUMP and no sequence
+	// number, and reads replies on this socket until NLMSG_DONE.
+	return dumpSet(s.fd, name)
+}
+
+func parseIpsetChange(cmd uint8, data []byte) (ipsetChange, error) {
+	// struct nfgenmsg { u8 family; u8 version; u16 res_id; }
+	if len(data) < 4 {
+		return ipsetChange{}, fmt.Errorf("ipsetsync: short ipset message")
+	}
+
+	attrs, err := parseAttrs(data[4:])
+	if err != nil {
+		return ipsetChange{}, err
+	}
+
+	name, ok := attrs[ipsetAttrSetname]
+	if !ok {
+		return ipsetChange{}, fmt.Errorf("ipsetsync: ipset message missing IPSET_ATTR_SETNAME")
+	}
+
+	change := ipsetChange{cmd: cmd, setName: cstring(name)}
+
+	if cmd == ipsetCmdSwap {
+		// IPSET_CMD_SWAP carries the second set name as
+		// IPSET_ATTR_TYPENAME in this minimal decode.
+		if other, ok := attrs[ipsetAttrTypename]; ok {
+			change.other = cstring(other)
+		}
+		return change, nil
+	}
+
+	if adt, ok := attrs[ipsetAttrADT]; ok {
+		if member, ok := parseMember(adt); ok {
+			change.member = member
+		}
+	}
+
+	return change, nil
+}
+
+func parseMember(adt []byte) (string, bool) {
+	entries, err := parseAttrs(adt)
+	if err != nil {
+		return "", false
+	}
+
+	// Each nested IPSET_ATTR_DATA entry describes one ADT
+	// (add/del/test) member, and one member is returned. entries is
+	// keyed by attribute type, so when adt holds several
+	// IPSET_ATTR_DATA entries only the last of them is decoded.
+	for _, raw := range entries {
+		data, err := parseAttrs(raw)
+		if err != nil {
+			continue
+		}
+
+		ipAttr, ok := data[ipsetAttrIP]
+		if !ok {
+			continue
+		}
+
+		ip, err := parseAttrs(ipAttr)
+		if err != nil {
+			continue
+		}
+
+		addr, ok := ip[ipsetAttrIPAddrIPv4]
+		if !ok || len(addr) != 4 {
+			continue
+		}
+
+		member := net.IP(addr).String()
+
+		// hash:net members carry their prefix length as
+		// IPSET_ATTR_CIDR; without it every member would be
+		// installed as a host (/32) route instead of its real
+		// network.
+		if cidr, ok := data[ipsetAttrCIDR]; ok && len(cidr) == 1 && cidr[0] != 32 {
+			member = fmt.Sprintf("%s/%d", member, cidr[0])
+		}
+
+		// hash:ip,port members carry a destination port (and,
+		// optionally, the IP protocol it applies to) that must be
+		// round-tripped through to memberKey, or the port match is
+		// silently dropped and the member degrades to a host-wide
+		// rule.
+		if portAttr, ok := data[ipsetAttrPort]; ok && len(portAttr) == 2 {
+			port := binary.BigEndian.Uint16(portAttr)
+			member = fmt.Sprintf("%s,%d", member, port)
+
+			if protoAttr, ok := data[ipsetAttrProto]; ok && len(protoAttr) == 1 {
+				member = fmt.Sprintf("%s,%d", member, protoAttr[0])
+			}
+		}
+
+		return member, true
+	}
+
+	return "", false
+}
+
+// dumpSet issues an IPSET_CMD_LIST request for name and collects the
+// IPv4 members out of the resulting dump messages.
+func dumpSet(fd int, name string) ([]string, error) {
+	req := buildListRequest(name)
+	if err := syscall.Sendto(fd, req, 0, nil); err != nil {
+		return nil, err
+	}
+
+	var members []string
+	buf := make([]byte, syscall.Getpagesize())
+
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		done := false
+		for _, msg := range msgs {
+			if msg.Header.Type == syscall.NLMSG_DONE {
+				done = true
+				continue
+			}
+
+			if len(msg.Data) < 4 {
+				continue
+			}
+
+			attrs, err := parseAttrs(msg.Data[4:])
+			if err != nil {
+				continue
+			}
+
+			// A dump message carries many members in one ADT, and
+			// parseMember decodes one, so hand it the ADT's
+			// entries one at a time.
+			if adt, ok := attrs[ipsetAttrADT]; ok {
+				for len(adt) >= 4 {
+					alen := int(nativeEndian.Uint16(adt[0:2]))
+					if alen < 4 || alen > len(adt) {
+						break
+					}
+					if member, ok := parseMember(adt[:alen]); ok {
+						members = append(members, member)
+					}
+					pad := (alen + 3) &^ 3
+					if pad > len(adt) {
+						break
+					}
+					adt = adt[pad:]
+				}
+			}
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return members, nil
+}
+
+func buildListRequest(name string) []byte {
+	nameAttr := putAttr(ipsetAttrSetname, append([]byte(name), 0))
+
+	// struct nfgenmsg{family=AF_INET, version=NFNETLINK_V0, res_id=0}
+	payload := append([]byte{syscall.AF_INET, 0, 0, 0}, nameAttr...)
+
+	hdr := syscall.NlMsghdr{
+		Len:   uint32(syscall.SizeofNlMsghdr) + uint32(len(payload)),
+		Type:  ipsetMsgType(ipsetCmdList),
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP,
+	}
+
+	buf := make([]byte, syscall.SizeofNlMsghdr)
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&buf[0])) = hdr
+
+	return append(buf, payload...)
+}
+
+func putAttr(atype uint16, value []byte) []byte {
+	alen := 4 + len(value)
+	buf := make([]byte, (alen+3)&^3)
+
+	nativeEndian.PutUint16(buf[0:2], uint16(alen))
+	nativeEndian.PutUint16(buf[2:4], atype)
+	copy(buf[4:], value)
+
+	return buf
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+const attrNestedFlag = 1 << 15
+
+func parseAttrs(data []byte) (map[int][]byte, error) {
+	attrs := make(map[int][]byte)
+
+	for len(data) >= 4 {
+		alen := nativeEndian.Uint16(data[0:2])
+		atype := nativeEndian.Uint16(data[2:4]) &^ attrNestedFlag
+
+		if int(alen) > len(data) || alen < 4 {
+			return nil, fmt.Errorf("ipsetsync: malformed netlink attribute")
+		}
+
+		attrs[int(atype)] = data[4:alen]
+
+		pad := (int(alen) + 3) &^ 3
+		if pad > len(data) {
+			break
+		}
+		data = data[pad:]
+	}
+
+	return attrs, nil
+}
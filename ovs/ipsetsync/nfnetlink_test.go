@@ -0,0 +1,49 @@
+package ipsetsync
+
+import "testing"
+
+func nestAttr(atype uint16, inner []byte) []byte {
+	return putAttr(atype, inner)
+}
+
+func TestParseMember(t *testing.T) {
+	tests := []struct {
+		name string
+		adt  []byte
+		want string
+	}{
+		{
+			name: "bare ip",
+			adt: nestAttr(0, putAttr(ipsetAttrIP,
+				nestAttr(ipsetAttrIPAddrIPv4, []byte{10, 0, 0, 1}))),
+			want: "10.0.0.1",
+		},
+		{
+			name: "hash:net cidr",
+			adt: nestAttr(0, append(
+				putAttr(ipsetAttrIP, nestAttr(ipsetAttrIPAddrIPv4, []byte{10, 0, 0, 0})),
+				putAttr(ipsetAttrCIDR, []byte{24})...)),
+			want: "10.0.0.0/24",
+		},
+		{
+			name: "hash:ip,port tcp",
+			adt: nestAttr(0, append(append(
+				putAttr(ipsetAttrIP, nestAttr(ipsetAttrIPAddrIPv4, []byte{10, 0, 0, 1})),
+				putAttr(ipsetAttrPort, []byte{0x1f, 0x90})...), // 8080
+				putAttr(ipsetAttrProto, []byte{6})...)),
+			want: "10.0.0.1,8080,6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMember(tt.adt)
+			if !ok {
+				t.Fatalf("parseMember() ok = false, want true")
+			}
+			if got != tt.want {
+				t.Errorf("parseMember() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package ovs
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+)
+
+type OvsEventKind int
+
+const (
+	DpNew OvsEventKind = iota
+	DpDel
+	VportNew
+	VportDel
+	VportMod
+	FlowNew
+	FlowDel
+	PacketMiss
+	PacketAction
+)
+
+type OvsEvent struct {
+	Kind     OvsEventKind
+	Datapath *OvsDatapathInfo
+	Vport    *OvsVportInfo
+	Flow     *OvsFlowInfo
+	Packet   *OvsPacketInfo
+}
+
+// MonitorOptions selects which of the four OVS generic-netlink
+// families to subscribe to on the shared monitor socket.
+type MonitorOptions struct {
+	Datapath bool
+	Vport    bool
+	Flow     bool
+	Packet   bool
+}
+
+// Monitor joins the multicast groups of the requested OVS families on
+// a single socket and demultiplexes them into a stream of OvsEvents.
+// The returned Cancelable shuts the socket down and stops the
+// delivery goroutine.
+func (dpif *Dpif) Monitor(opts MonitorOptions) (<-chan OvsEvent, Cancelable, error) {
+	type subscription struct {
+		family int
+		name   string
+	}
+
+	var subs []subscription
+	if opts.Datapath {
+		subs = append(subs, subscription{DATAPATH, "ovs_datapath"})
+	}
+	if opts.Vport {
+		subs = append(subs, subscription{VPORT, "ovs_vport"})
+	}
+	if opts.Flow {
+		subs = append(subs, subscription{FLOW, "ovs_flow"})
+	}
+	if opts.Packet {
+		subs = append(subs, subscription{PACKET, "ovs_packet"})
+	}
+
+	for _, sub := range subs {
+		group, err := dpif.getMCGroup(sub.family, sub.name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := syscall.SetsockoptInt(dpif.sock.fd, SOL_NETLINK, syscall.NETLINK_ADD_MEMBERSHIP, int(group)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	events := make(chan OvsEvent)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer close(events)
+
+		for {
+			msgs, err := dpif.sock.ReceiveMulti()
+			if err != nil {
+				return
+			}
+
+			for _, msg := range msgs {
+				ev, err := dpif.decodeMonitorEvent(msg)
+				if err != nil {
+					continue
+				}
+
+				select {
+				case events <- ev:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	cancel := func() error {
+		close(done)
+		// The reader goroutine is normally blocked in
+		// dpif.sock.ReceiveMulti(), which only notices done between
+		// reads; closing the socket breaks it out of that blocking
+		// read so Cancel() can't hang waiting for the next multicast
+		// message.
+		err := dpif.Close()
+		wg.Wait()
+		return err
+	}
+
+	return events, cancelableFunc(cancel), nil
+}
+
+func (dpif *Dpif) familyOf(familyID uint16) (int, bool) {
+	for i := 0; i < FAMILY_COUNT; i++ {
+		if dpif.families[i].id == familyID {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func (dpif *Dpif) decodeMonitorEvent(msg *NlMsgParser) (OvsEvent, error) {
+	family, ok := dpif.familyOf(msg.PeekNlMsghdr().Type)
+	if !ok {
+		return OvsEvent{}, fmt.Errorf("netlink message from unknown genl family")
+	}
+
+	genlhdr, ovshdr, err := dpif.checkNlMsgHeaders(msg, family, -1)
+	if err != nil {
+		return OvsEvent{}, err
+	}
+
+	switch family {
+	case DATAPATH:
+		return dpif.decodeDatapathEvent(msg, genlhdr, ovshdr)
+	case VPORT:
+		return dpif.decodeVportEvent(msg, genlhdr, ovshdr)
+	case FLOW:
+		return dpif.decodeFlowEvent(msg, genlhdr, ovshdr)
+	case PACKET:
+		return dpif.decodePacketEvent(msg, genlhdr, ovshdr)
+	default:
+		return OvsEvent{}, fmt.Errorf("unhandled genl family %d", family)
+	}
+}
+
+func (dpif *Dpif) decodeDatapathEvent(msg *NlMsgParser, genlhdr *GenlMsghdr, ovshdr *OvsHeader) (OvsEvent, error) {
+	dp, err := parseDatapathInfo(msg, ovshdr)
+	if err != nil {
+		return OvsEvent{}, err
+	}
+
+	kind := DpNew
+	if genlhdr.Cmd == OVS_DP_CMD_DEL {
+		kind = DpDel
+	}
+
+	return OvsEvent{Kind: kind, Datapath: dp}, nil
+}
+
+func (dpif *Dpif) decodeVportEvent(msg *NlMsgParser, genlhdr *GenlMsghdr, ovshdr *OvsHeader) (OvsEvent, error) {
+	vport, err := parseVportInfo(msg, ovshdr)
+	if err != nil {
+		return OvsEvent{}, err
+	}
+
+	var kind OvsEventKind
+	switch genlhdr.Cmd {
+	case OVS_VPORT_CMD_DEL:
+		kind = VportDel
+	case OVS_VPORT_CMD_SET:
+		kind = VportMod
+	default:
+		kind = VportNew
+	}
+
+	return OvsEvent{Kind: kind, Vport: vport}, nil
+}
+
+func (dpif *Dpif) decodeFlowEvent(msg *NlMsgParser, genlhdr *GenlMsghdr, ovshdr *OvsHeader) (OvsEvent, error) {
+	flow, err := parseFlowInfo(msg, ovshdr)
+	if err != nil {
+		return OvsEvent{}, err
+	}
+
+	kind := FlowNew
+	if genlhdr.Cmd == OVS_FLOW_CMD_DEL {
+		kind = FlowDel
+	}
+
+	return OvsEvent{Kind: kind, Flow: flow}, nil
+}
+
+func (dpif *Dpif) decodePacketEvent(msg *NlMsgParser, genlhdr *GenlMsghdr, ovshdr *OvsHeader) (OvsEvent, error) {
+	packet, err := parsePacketInfo(msg, ovshdr)
+	if err != nil {
+		return OvsEvent{}, err
+	}
+
+	kind := PacketMiss
+	if genlhdr.Cmd == OVS_PACKET_CMD_ACTION {
+		kind = PacketAction
+	}
+
+	return OvsEvent{Kind: kind, Packet: packet}, nil
+}
+
+type cancelableFunc func() error
+
+func (f cancelableFunc) Cancel() error {
+	return f()
+}
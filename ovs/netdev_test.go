@@ -0,0 +1,72 @@
+package ovs
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSplitTopLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{
+			name: "flat terms",
+			in:   "ipv4(src=1.1.1.1,dst=2.2.2.2),tcp(src=80,dst=8080)",
+			want: []string{"ipv4(src=1.1.1.1,dst=2.2.2.2)", "tcp(src=80,dst=8080)"},
+		},
+		{
+			name: "single term",
+			in:   "ipv4(src=1.1.1.1)",
+			want: []string{"ipv4(src=1.1.1.1)"},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTopLevel(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitTopLevel(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlowDumpLine(t *testing.T) {
+	line := "ipv4(src=10.0.0.1,dst=10.0.0.2,proto=6),tcp(src=1234,dst=80), packets:3, bytes:180, used:0.100s, actions:1"
+
+	flow, err := parseFlowDumpLine(line)
+	if err != nil {
+		t.Fatalf("parseFlowDumpLine: %v", err)
+	}
+
+	ipv4 := flow.FlowKeySpec.Key[OVS_KEY_ATTR_IPV4].(OvsIPv4Key)
+	if !ipv4.Src.Equal(net.ParseIP("10.0.0.1")) || !ipv4.Dst.Equal(net.ParseIP("10.0.0.2")) || ipv4.Proto != 6 {
+		t.Errorf("ipv4 key = %+v, want src=10.0.0.1 dst=10.0.0.2 proto=6", ipv4)
+	}
+
+	tcp := flow.FlowKeySpec.Key[OVS_KEY_ATTR_TCP].(OvsTpKey)
+	if tcp.Src != 1234 || tcp.Dst != 80 {
+		t.Errorf("tcp key = %+v, want src=1234 dst=80", tcp)
+	}
+}
+
+func TestParseFlowDumpLineIgnoresUnknownTerms(t *testing.T) {
+	line := "in_port(1),eth(),ipv4(src=10.0.0.1,dst=10.0.0.2,proto=17),udp(src=53,dst=53), packets:1, actions:2"
+
+	flow, err := parseFlowDumpLine(line)
+	if err != nil {
+		t.Fatalf("parseFlowDumpLine: %v", err)
+	}
+
+	if _, ok := flow.FlowKeySpec.Key[OVS_KEY_ATTR_UDP]; !ok {
+		t.Fatalf("FlowKeySpec.Key missing OVS_KEY_ATTR_UDP")
+	}
+}
@@ -4,48 +4,180 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 )
 
+// DatapathSelector picks the set of datapaths FollowOvsFlowsFrom
+// should subscribe to: a single datapath by name or id, or every
+// datapath the kernel module currently knows about.
+type DatapathSelector struct {
+	all   bool
+	name  string
+	id    DatapathID
+	hasID bool
+}
+
+// ByName selects a single datapath by name, e.g. "ovs-system".
+func ByName(name string) DatapathSelector {
+	return DatapathSelector{name: name}
+}
+
+// ByID selects a single datapath by its ifindex.
+func ByID(id DatapathID) DatapathSelector {
+	return DatapathSelector{id: id, hasID: true}
+}
+
+// All selects every datapath currently registered with the kernel
+// module.
+func All() DatapathSelector {
+	return DatapathSelector{all: true}
+}
+
+// ParseDatapathSelector accepts either a datapath name or a datapath
+// id. Since a name can itself look like a number, the selector tries
+// the string as a name first and only falls back to interpreting it
+// as an id if that lookup fails, matching the original lookupDatapath
+// heuristic this selector replaced.
+func ParseDatapathSelector(s string) DatapathSelector {
+	if ifindex, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return DatapathSelector{name: s, id: DatapathID(ifindex), hasID: true}
+	}
+
+	return ByName(s)
+}
+
 func FollowOvsFlows() (<-chan *OvsFlowInfo, func(), error) {
+	return FollowOvsFlowsFrom(ByName("ovs-system"))
+}
 
+// FollowOvsFlowsFrom is like FollowOvsFlows but follows the
+// datapath(s) picked out by sel, fanning the flows of multiple
+// datapaths (as selected by All()) into a single channel.
+func FollowOvsFlowsFrom(sel DatapathSelector) (<-chan *OvsFlowInfo, func(), error) {
 	dpif, err := NewDpifOvs(true)
-
 	if err != nil {
 		return nil, nil, err
 	}
 
-	dp, _, err := lookupDatapath(dpif, "ovs-system")
+	dps, err := lookupDatapaths(dpif, sel)
 	if err != nil {
+		dpif.Close()
 		return nil, nil, err
 	}
-	res, stop, err := dp.FollowFlows()
-	return res, func() { stop(); dpif.Close() }, err
 
+	return followMerged(dpif, dps)
 }
 
-func lookupDatapath(dpif *Dpif, name string) (*DatapathHandle, string, error) {
-	dph, err := dpif.LookupDatapath(name)
-	if err == nil {
-		return &dph, name, nil
+func lookupDatapaths(dpif *Dpif, sel DatapathSelector) ([]*DatapathHandle, error) {
+	if sel.all {
+		infos, err := dpif.DpifEnumerate()
+		if err != nil {
+			return nil, err
+		}
+
+		dps := make([]*DatapathHandle, 0, len(infos))
+		for _, info := range infos {
+			dp, err := dpif.LookupDatapathByID(info.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			dps = append(dps, &dp.Handle)
+		}
+
+		return dps, nil
 	}
 
-	if !IsNoSuchDatapathError(err) {
-		return nil, "", err
+	dph, _, err := lookupDatapath(dpif, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*DatapathHandle{dph}, nil
+}
+
+// followMerged opens a follow socket per datapath handle and fans
+// all of them into a single channel, behind a stop func that tears
+// every one of them down.
+func followMerged(dpif *Dpif, dps []*DatapathHandle) (<-chan *OvsFlowInfo, func(), error) {
+	if len(dps) == 1 {
+		res, stop, err := dps[0].FollowFlows()
+		if err != nil {
+			dpif.Close()
+			return nil, nil, err
+		}
+
+		return res, func() { stop(); dpif.Close() }, nil
+	}
+
+	out := make(chan *OvsFlowInfo)
+	done := make(chan struct{})
+	stops := make([]func(), 0, len(dps))
+
+	cleanup := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, dp := range dps {
+		res, stop, err := dp.FollowFlows()
+		if err != nil {
+			cleanup()
+			dpif.Close()
+			return nil, nil, err
+		}
+
+		stops = append(stops, stop)
+
+		wg.Add(1)
+		go func(res <-chan *OvsFlowInfo) {
+			defer wg.Done()
+			for flow := range res {
+				select {
+				case out <- flow:
+				case <-done:
+					return
+				}
+			}
+		}(res)
 	}
 
-	// If the name is a number, try to use it as an id
-	ifindex, err := strconv.ParseUint(name, 10, 32)
-	if err == nil {
-		dp, err := dpif.LookupDatapathByID(DatapathID(ifindex))
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	stopAll := func() {
+		close(done)
+		cleanup()
+		dpif.Close()
+	}
+
+	return out, stopAll, nil
+}
+
+func lookupDatapath(dpif *Dpif, sel DatapathSelector) (*DatapathHandle, string, error) {
+	if sel.name != "" {
+		dph, err := dpif.LookupDatapath(sel.name)
 		if err == nil {
-			return &dp.Handle, dp.Name, nil
+			return &dph, sel.name, nil
 		}
 
 		if !IsNoSuchDatapathError(err) {
-
 			return nil, "", err
 		}
+
+		if !sel.hasID {
+			return nil, "", errors.New(fmt.Sprintf("Cannot find datapath \"%s\"", sel.name))
+		}
+	}
+
+	dp, err := dpif.LookupDatapathByID(sel.id)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return nil, "", errors.New(fmt.Sprintf("Cannot find datapath \"%s\"", name))
+	return &dp.Handle, dp.Name, nil
 }